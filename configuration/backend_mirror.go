@@ -0,0 +1,111 @@
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/haproxytech/models"
+)
+
+// ruleBackendKey returns the StorageBackend key a rule set is mirrored
+// under, stable across Create/Edit/Delete/Get so a CAS write and the read
+// that follows it always agree on where to look.
+func ruleBackendKey(parentType, parentName, ruleKind string) string {
+	return "rules/" + parentType + "/" + parentName + "/" + ruleKind
+}
+
+// splitRuleBackendKey is the inverse of ruleBackendKey, used to recover the
+// parent a mirrored etcd watch event belongs to.
+func splitRuleBackendKey(key string) (parentType, parentName, ruleKind string, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(key, "rules/"), "/", 3)
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("configuration: unrecognized rule backend key %q", key)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// lastLocalRuleWrite remembers, per ruleBackendKey, the value this process
+// last CAS-wrote to a shared backend. mirrorEtcdRuleChanges consults it to
+// recognize and drop the etcd watch event that its own write produces,
+// rather than republishing a change this Client already published at its
+// CRUD call site.
+var lastLocalRuleWrite sync.Map // ruleBackendKey -> []byte
+
+// usesSharedBackend reports whether c.Backend keeps its own authoritative,
+// shared copy of rule state (currently EtcdV3Backend) as opposed to
+// LBCTLBackend, whose authoritative copy is the local HAProxy config file
+// itself, read straight back out through lbctl.
+func (c *Client) usesSharedBackend() (StorageBackend, bool) {
+	if _, ok := c.Backend.(*LBCTLBackend); ok {
+		return nil, false
+	}
+	return c.Backend, true
+}
+
+// mirrorBackendSwitchingRules CAS-writes the full backend switching rule set
+// for frontend into a shared backend (see usesSharedBackend), so several
+// controllers sharing the same etcd cluster see a consistent view instead of
+// racing to clobber each other's writes. It is a no-op for LBCTLBackend,
+// whose writes already land in the file mutate re-reads straight from.
+func (c *Client) mirrorBackendSwitchingRules(frontend string, mutate func(models.BackendSwitchingRules) models.BackendSwitchingRules) error {
+	backend, ok := c.usesSharedBackend()
+	if !ok {
+		return nil
+	}
+	key := ruleBackendKey("frontend", frontend, "backend_switching_rule")
+
+	raw, rev, err := backend.Get(key)
+	if err != nil {
+		return err
+	}
+	var rules models.BackendSwitchingRules
+	if raw != nil {
+		if err := json.Unmarshal(raw, &rules); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(mutate(rules))
+	if err != nil {
+		return err
+	}
+	if err := backend.Write(context.Background(), key, data, rev); err != nil {
+		return err
+	}
+	lastLocalRuleWrite.Store(key, data)
+	return nil
+}
+
+// mirrorTCPContentRules is the TCP content rule equivalent of
+// mirrorBackendSwitchingRules.
+func (c *Client) mirrorTCPContentRules(parentType, parentName, ruleType string, mutate func(models.TCPRules) models.TCPRules) error {
+	backend, ok := c.usesSharedBackend()
+	if !ok {
+		return nil
+	}
+	key := ruleBackendKey(parentType, parentName, "tcp_content_rule_"+ruleType)
+
+	raw, rev, err := backend.Get(key)
+	if err != nil {
+		return err
+	}
+	var rules models.TCPRules
+	if raw != nil {
+		if err := json.Unmarshal(raw, &rules); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(mutate(rules))
+	if err != nil {
+		return err
+	}
+	if err := backend.Write(context.Background(), key, data, rev); err != nil {
+		return err
+	}
+	lastLocalRuleWrite.Store(key, data)
+	return nil
+}
@@ -0,0 +1,21 @@
+package configuration
+
+import "testing"
+
+func TestRuleBackendKeyRoundTrip(t *testing.T) {
+	key := ruleBackendKey("frontend", "fe1", "backend_switching_rule")
+
+	parentType, parentName, ruleKind, err := splitRuleBackendKey(key)
+	if err != nil {
+		t.Fatalf("splitRuleBackendKey(%q): %v", key, err)
+	}
+	if parentType != "frontend" || parentName != "fe1" || ruleKind != "backend_switching_rule" {
+		t.Errorf("splitRuleBackendKey(%q) = %q, %q, %q; want frontend, fe1, backend_switching_rule", key, parentType, parentName, ruleKind)
+	}
+}
+
+func TestSplitRuleBackendKeyRejectsMalformedKey(t *testing.T) {
+	if _, _, _, err := splitRuleBackendKey("rules/frontend"); err == nil {
+		t.Error("expected an error for a rule backend key missing its rule kind segment")
+	}
+}
@@ -1,6 +1,7 @@
 package configuration
 
 import (
+	"encoding/json"
 	"strconv"
 	"strings"
 
@@ -17,13 +18,25 @@ func (c *Client) GetBackendSwitchingRules(frontend string, transactionID string)
 			return &models.GetBackendSwitchingRulesOKBody{Version: c.Cache.Version.Get(transactionID), Data: bckRules}, nil
 		}
 	}
-	bckRulesString, err := c.executeLBCTL("l7-service-usefarm-dump", transactionID, frontend)
-	if err != nil {
-		return nil, err
+	var bckRules models.BackendSwitchingRules
+	if _, shared := c.usesSharedBackend(); shared {
+		raw, _, err := c.Backend.Get(ruleBackendKey("frontend", frontend, "backend_switching_rule"))
+		if err != nil {
+			return nil, err
+		}
+		if raw != nil {
+			if err := json.Unmarshal(raw, &bckRules); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		bckRulesRaw, _, err := c.Backend.Read("frontend", frontend, "l7-service-usefarm", transactionID)
+		if err != nil {
+			return nil, err
+		}
+		bckRules = c.parseBackendSwitchingRules(string(bckRulesRaw))
 	}
 
-	bckRules := c.parseBackendSwitchingRules(bckRulesString)
-
 	v, err := c.GetVersion(transactionID)
 	if err != nil {
 		return nil, err
@@ -71,9 +84,22 @@ func (c *Client) DeleteBackendSwitchingRule(id int64, frontend string, transacti
 	if err != nil {
 		return err
 	}
+	err = c.mirrorBackendSwitchingRules(frontend, func(rules models.BackendSwitchingRules) models.BackendSwitchingRules {
+		out := rules[:0]
+		for _, rule := range rules {
+			if rule.ID != id {
+				out = append(out, rule)
+			}
+		}
+		return out
+	})
+	if err != nil {
+		return err
+	}
 	if c.Cache.Enabled() {
 		c.Cache.BackendSwitchingRules.InvalidateFrontend(transactionID, frontend)
 	}
+	c.publishRuleEvent(RuleEvent{ParentType: "frontend", ParentName: frontend, RuleKind: "backend_switching_rule", ID: strconv.FormatInt(id, 10), Op: RuleOpDelete})
 	return nil
 }
 
@@ -90,9 +116,16 @@ func (c *Client) CreateBackendSwitchingRule(frontend string, data *models.Backen
 	if err != nil {
 		return err
 	}
+	err = c.mirrorBackendSwitchingRules(frontend, func(rules models.BackendSwitchingRules) models.BackendSwitchingRules {
+		return append(rules, data)
+	})
+	if err != nil {
+		return err
+	}
 	if c.Cache.Enabled() {
 		c.Cache.BackendSwitchingRules.InvalidateFrontend(transactionID, frontend)
 	}
+	c.publishRuleEvent(RuleEvent{ParentType: "frontend", ParentName: frontend, RuleKind: "backend_switching_rule", ID: strconv.FormatInt(data.ID, 10), Op: RuleOpCreate, After: data})
 	return nil
 }
 
@@ -114,9 +147,22 @@ func (c *Client) EditBackendSwitchingRule(id int64, frontend string, data *model
 	if err != nil {
 		return err
 	}
+	err = c.mirrorBackendSwitchingRules(frontend, func(rules models.BackendSwitchingRules) models.BackendSwitchingRules {
+		for i, rule := range rules {
+			if rule.ID == data.ID {
+				rules[i] = data
+				return rules
+			}
+		}
+		return append(rules, data)
+	})
+	if err != nil {
+		return err
+	}
 	if c.Cache.Enabled() {
 		c.Cache.BackendSwitchingRules.InvalidateFrontend(transactionID, frontend)
 	}
+	c.publishRuleEvent(RuleEvent{ParentType: "frontend", ParentName: frontend, RuleKind: "backend_switching_rule", ID: strconv.FormatInt(data.ID, 10), Op: RuleOpEdit, Before: ondiskBr.Data, After: data})
 	return nil
 }
 
@@ -0,0 +1,362 @@
+package configuration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/template"
+
+	"github.com/haproxytech/models"
+)
+
+// ConfigTemplate is a named, reusable bundle of frontend/backend/rule
+// definitions with Go-template placeholders, resolved against the values
+// passed to ApplyConfig.
+type ConfigTemplate struct {
+	Name string `json:"name"`
+	// Body is a Go text/template whose executed output must be the JSON
+	// encoding of a configTemplateDocument.
+	Body string `json:"body"`
+}
+
+// configTemplateDocument is what a rendered ConfigTemplate must decode
+// into: the objects ApplyConfig creates or, for ones that already exist,
+// edits inside a single transaction.
+type configTemplateDocument struct {
+	Frontends             []*models.Frontend                      `json:"frontends"`
+	Backends              []*models.Backend                       `json:"backends"`
+	BackendSwitchingRules map[string]models.BackendSwitchingRules `json:"backend_switching_rules"`
+	Servers               map[string]models.Servers               `json:"servers"`
+}
+
+// NewConfigTemplate parses body as a Go text/template named name, failing
+// fast on a syntax error rather than at ApplyConfig time.
+func NewConfigTemplate(name, body string) (ConfigTemplate, error) {
+	if _, err := template.New(name).Parse(body); err != nil {
+		return ConfigTemplate{}, NewConfError(ErrValidationError, err.Error())
+	}
+	return ConfigTemplate{Name: name, Body: body}, nil
+}
+
+// CreateConfigTemplate stores tmpl under name so later ApplyConfig calls can
+// instantiate it, creating it if name is new or overwriting it in place if
+// it already exists. Templates persist in the client's StorageBackend
+// alongside the HAProxy configuration itself.
+func (c *Client) CreateConfigTemplate(name string, tmpl ConfigTemplate) error {
+	data, err := json.Marshal(tmpl)
+	if err != nil {
+		return err
+	}
+	_, rev, err := c.Backend.Get("templates/" + name)
+	if err != nil {
+		return err
+	}
+	return c.Backend.Write(context.Background(), "templates/"+name, data, rev)
+}
+
+// abortTransaction best-effort deletes transactionID so a transaction left
+// open by a failed ApplyConfig or RollbackConfig doesn't stay stranded on
+// HAProxy. Its own error is not reported: the caller is already returning
+// the failure that triggered the abort, and that failure is what matters to
+// them.
+func (c *Client) abortTransaction(transactionID string) {
+	_, _ = c.executeLBCTL("transaction-delete", transactionID)
+}
+
+// configOp records one object ApplyConfig created or changed, in creation
+// order, so RollbackConfig can reverse it later. Before is nil for an object
+// that was created (rollback deletes it) and holds the object's prior JSON
+// snapshot for one that was edited (rollback restores it).
+type configOp struct {
+	Kind   string          `json:"kind"` // "frontend", "backend", "backend_switching_rule", "server"
+	Parent string          `json:"parent,omitempty"`
+	ID     string          `json:"id"`
+	Before json.RawMessage `json:"before,omitempty"`
+}
+
+// ConfigInstance is the record of one ApplyConfig call: which template it
+// instantiated and the inverse operations RollbackConfig needs to undo it.
+type ConfigInstance struct {
+	ID       string     `json:"id"`
+	Template string     `json:"template"`
+	Ops      []configOp `json:"ops"`
+}
+
+// applyConfigTemplateObject creates or edits one object a rendered
+// ConfigTemplate declares. If an object of this kind/id/parent already
+// exists, prior is snapshotted as the configOp's Before so RollbackConfig
+// can restore it; otherwise create is called and rollback will delete what
+// it made instead.
+func (c *Client) applyConfigTemplateObject(kind, id, parent string, exists bool, prior interface{}, create, edit func() error) (configOp, error) {
+	if exists {
+		before, err := json.Marshal(prior)
+		if err != nil {
+			return configOp{}, err
+		}
+		if err := edit(); err != nil {
+			return configOp{}, err
+		}
+		return configOp{Kind: kind, Parent: parent, ID: id, Before: before}, nil
+	}
+	if err := create(); err != nil {
+		return configOp{}, err
+	}
+	return configOp{Kind: kind, Parent: parent, ID: id}, nil
+}
+
+// ApplyConfig instantiates the named ConfigTemplate with values inside a
+// single transaction: objects that don't exist yet are created, objects that
+// already do are edited in place with their prior state snapshotted. It
+// returns the instanceID RollbackConfig later needs to undo it.
+func (c *Client) ApplyConfig(templateName string, values map[string]interface{}) (string, error) {
+	raw, _, err := c.Backend.Get("templates/" + templateName)
+	if err != nil {
+		return "", err
+	}
+	if raw == nil {
+		return "", fmt.Errorf("configuration: config template %q does not exist", templateName)
+	}
+	var tmpl ConfigTemplate
+	if err := json.Unmarshal(raw, &tmpl); err != nil {
+		return "", err
+	}
+
+	tpl, err := template.New(tmpl.Name).Parse(tmpl.Body)
+	if err != nil {
+		return "", err
+	}
+	var rendered bytes.Buffer
+	if err := tpl.Execute(&rendered, values); err != nil {
+		return "", err
+	}
+	var doc configTemplateDocument
+	if err := json.Unmarshal(rendered.Bytes(), &doc); err != nil {
+		return "", NewConfError(ErrValidationError, fmt.Sprintf("rendered template %s is not valid: %v", templateName, err))
+	}
+
+	version, err := c.GetVersion("")
+	if err != nil {
+		return "", err
+	}
+	transaction, err := c.StartTransaction(version)
+	if err != nil {
+		return "", err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			c.abortTransaction(transaction.ID)
+		}
+	}()
+
+	instance := &ConfigInstance{ID: "inst-" + transaction.ID, Template: templateName}
+
+	existingFrontends, err := c.GetFrontends()
+	if err != nil {
+		return "", err
+	}
+	frontendsByName := make(map[string]*models.Frontend, len(existingFrontends.Data))
+	for _, frontend := range existingFrontends.Data {
+		frontendsByName[frontend.Name] = frontend
+	}
+	for _, frontend := range doc.Frontends {
+		prior, exists := frontendsByName[frontend.Name]
+		op, err := c.applyConfigTemplateObject("frontend", frontend.Name, "", exists, prior,
+			func() error { return c.CreateFrontend(frontend, transaction.ID, 0) },
+			func() error { return c.EditFrontend(frontend.Name, frontend, transaction.ID, 0) },
+		)
+		if err != nil {
+			return "", err
+		}
+		instance.Ops = append(instance.Ops, op)
+	}
+
+	existingBackends, err := c.GetBackends()
+	if err != nil {
+		return "", err
+	}
+	backendsByName := make(map[string]*models.Backend, len(existingBackends.Data))
+	for _, backend := range existingBackends.Data {
+		backendsByName[backend.Name] = backend
+	}
+	for _, backend := range doc.Backends {
+		prior, exists := backendsByName[backend.Name]
+		op, err := c.applyConfigTemplateObject("backend", backend.Name, "", exists, prior,
+			func() error { return c.CreateBackend(backend, transaction.ID, 0) },
+			func() error { return c.EditBackend(backend.Name, backend, transaction.ID, 0) },
+		)
+		if err != nil {
+			return "", err
+		}
+		instance.Ops = append(instance.Ops, op)
+	}
+
+	for frontend, rules := range doc.BackendSwitchingRules {
+		existingRules, err := c.GetBackendSwitchingRules(frontend, transaction.ID)
+		if err != nil {
+			return "", err
+		}
+		rulesByID := make(map[int64]*models.BackendSwitchingRule, len(existingRules.Data))
+		for _, rule := range existingRules.Data {
+			rulesByID[rule.ID] = rule
+		}
+		for _, rule := range rules {
+			id := strconv.FormatInt(rule.ID, 10)
+			prior, exists := rulesByID[rule.ID]
+			op, err := c.applyConfigTemplateObject("backend_switching_rule", id, frontend, exists, prior,
+				func() error { return c.CreateBackendSwitchingRule(frontend, rule, transaction.ID, 0) },
+				func() error { return c.EditBackendSwitchingRule(rule.ID, frontend, rule, transaction.ID, 0) },
+			)
+			if err != nil {
+				return "", err
+			}
+			instance.Ops = append(instance.Ops, op)
+		}
+	}
+
+	for backend, servers := range doc.Servers {
+		existingServers, err := c.GetServers(backend)
+		if err != nil {
+			return "", err
+		}
+		serversByName := make(map[string]*models.Server, len(existingServers.Data))
+		for _, server := range existingServers.Data {
+			serversByName[server.Name] = server
+		}
+		for _, server := range servers {
+			prior, exists := serversByName[server.Name]
+			op, err := c.applyConfigTemplateObject("server", server.Name, backend, exists, prior,
+				func() error { return c.CreateServer(backend, server, transaction.ID, 0) },
+				func() error { return c.EditServer(server.Name, backend, server, transaction.ID, 0) },
+			)
+			if err != nil {
+				return "", err
+			}
+			instance.Ops = append(instance.Ops, op)
+		}
+	}
+
+	if err := c.CommitTransaction(transaction.ID); err != nil {
+		return "", err
+	}
+	committed = true
+
+	instanceData, err := json.Marshal(instance)
+	if err != nil {
+		return "", err
+	}
+	if err := c.Backend.Write(context.Background(), "instances/"+instance.ID, instanceData, 0); err != nil {
+		return "", err
+	}
+
+	return instance.ID, nil
+}
+
+// RollbackConfig reverses everything ApplyConfig did for instanceID inside a
+// single transaction: objects it created are deleted, objects it edited are
+// restored to their prior snapshot. Ops are undone in reverse order so a
+// dependent object (e.g. a backend switching rule) is removed before
+// anything it points at.
+func (c *Client) RollbackConfig(instanceID string) error {
+	raw, _, err := c.Backend.Get("instances/" + instanceID)
+	if err != nil {
+		return err
+	}
+	if raw == nil {
+		return fmt.Errorf("configuration: config instance %q does not exist", instanceID)
+	}
+	var instance ConfigInstance
+	if err := json.Unmarshal(raw, &instance); err != nil {
+		return err
+	}
+
+	version, err := c.GetVersion("")
+	if err != nil {
+		return err
+	}
+	transaction, err := c.StartTransaction(version)
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			c.abortTransaction(transaction.ID)
+		}
+	}()
+
+	for i := len(instance.Ops) - 1; i >= 0; i-- {
+		op := instance.Ops[i]
+		if op.Before != nil {
+			if err := c.restoreConfigOp(op, transaction.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.deleteConfigOp(op, transaction.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := c.CommitTransaction(transaction.ID); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+func (c *Client) deleteConfigOp(op configOp, transactionID string) error {
+	switch op.Kind {
+	case "frontend":
+		return c.DeleteFrontend(op.ID, transactionID, 0)
+	case "backend":
+		return c.DeleteBackend(op.ID, transactionID, 0)
+	case "server":
+		return c.DeleteServer(op.ID, op.Parent, transactionID, 0)
+	case "backend_switching_rule":
+		id, err := strconv.ParseInt(op.ID, 10, 64)
+		if err != nil {
+			return err
+		}
+		return c.DeleteBackendSwitchingRule(id, op.Parent, transactionID, 0)
+	default:
+		return fmt.Errorf("configuration: unknown config op kind %q", op.Kind)
+	}
+}
+
+func (c *Client) restoreConfigOp(op configOp, transactionID string) error {
+	switch op.Kind {
+	case "frontend":
+		data := &models.Frontend{}
+		if err := json.Unmarshal(op.Before, data); err != nil {
+			return err
+		}
+		return c.EditFrontend(op.ID, data, transactionID, 0)
+	case "backend":
+		data := &models.Backend{}
+		if err := json.Unmarshal(op.Before, data); err != nil {
+			return err
+		}
+		return c.EditBackend(op.ID, data, transactionID, 0)
+	case "server":
+		data := &models.Server{}
+		if err := json.Unmarshal(op.Before, data); err != nil {
+			return err
+		}
+		return c.EditServer(op.ID, op.Parent, data, transactionID, 0)
+	case "backend_switching_rule":
+		data := &models.BackendSwitchingRule{}
+		if err := json.Unmarshal(op.Before, data); err != nil {
+			return err
+		}
+		id, err := strconv.ParseInt(op.ID, 10, 64)
+		if err != nil {
+			return err
+		}
+		return c.EditBackendSwitchingRule(id, op.Parent, data, transactionID, 0)
+	default:
+		return fmt.Errorf("configuration: unknown config op kind %q", op.Kind)
+	}
+}
@@ -0,0 +1,86 @@
+package configuration
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+type fakeConfigObject struct {
+	Name string `json:"name"`
+}
+
+func TestApplyConfigTemplateObjectCreatesWhenAbsent(t *testing.T) {
+	c := &Client{}
+	var created bool
+
+	op, err := c.applyConfigTemplateObject("frontend", "fe1", "", false, nil,
+		func() error { created = true; return nil },
+		func() error { t.Fatal("edit must not be called when the object does not exist"); return nil },
+	)
+	if err != nil {
+		t.Fatalf("applyConfigTemplateObject: %v", err)
+	}
+	if !created {
+		t.Error("expected create to be called for a new object")
+	}
+	if op.Before != nil {
+		t.Errorf("a created object's op must have a nil Before, got %s", op.Before)
+	}
+	if op.Kind != "frontend" || op.ID != "fe1" {
+		t.Errorf("op = %+v; want Kind=frontend ID=fe1", op)
+	}
+}
+
+func TestApplyConfigTemplateObjectEditsAndSnapshotsWhenPresent(t *testing.T) {
+	c := &Client{}
+	prior := fakeConfigObject{Name: "fe1-old"}
+	var edited bool
+
+	op, err := c.applyConfigTemplateObject("frontend", "fe1", "", true, prior,
+		func() error { t.Fatal("create must not be called when the object already exists"); return nil },
+		func() error { edited = true; return nil },
+	)
+	if err != nil {
+		t.Fatalf("applyConfigTemplateObject: %v", err)
+	}
+	if !edited {
+		t.Error("expected edit to be called for a pre-existing object")
+	}
+	if op.Before == nil {
+		t.Fatal("an edited object's op must snapshot Before so RollbackConfig can restore it")
+	}
+	var got fakeConfigObject
+	if err := json.Unmarshal(op.Before, &got); err != nil {
+		t.Fatalf("op.Before is not valid JSON: %v", err)
+	}
+	if got != prior {
+		t.Errorf("op.Before = %+v; want %+v", got, prior)
+	}
+}
+
+func TestApplyConfigTemplateObjectPropagatesCreateError(t *testing.T) {
+	c := &Client{}
+	wantErr := errors.New("boom")
+
+	_, err := c.applyConfigTemplateObject("frontend", "fe1", "", false, nil,
+		func() error { return wantErr },
+		func() error { return nil },
+	)
+	if !errors.Is(err, wantErr) {
+		t.Errorf("applyConfigTemplateObject swallowed the create error, got %v", err)
+	}
+}
+
+func TestApplyConfigTemplateObjectPropagatesEditError(t *testing.T) {
+	c := &Client{}
+	wantErr := errors.New("boom")
+
+	_, err := c.applyConfigTemplateObject("frontend", "fe1", "", true, fakeConfigObject{},
+		func() error { return nil },
+		func() error { return wantErr },
+	)
+	if !errors.Is(err, wantErr) {
+		t.Errorf("applyConfigTemplateObject swallowed the edit error, got %v", err)
+	}
+}
@@ -1,17 +1,26 @@
 package configuration
 
 import (
+	"context"
+	"io"
+
 	"github.com/haproxytech/models"
 )
 
 // ClientParams is just a placeholder for all client options
 type ClientParams struct {
 	configurationFile string
+	backend           StorageBackend
 }
 
-// NewConfigurationClientParams creates a new configuration client.
-func NewConfigurationClientParams(configurationFile string) *ClientParams {
-	return &ClientParams{configurationFile: configurationFile}
+// NewConfigurationClientParams creates a new configuration client. backend
+// may be nil, in which case the client falls back to an LBCTLBackend driving
+// configurationFile directly, matching this client's historical behaviour.
+func NewConfigurationClientParams(configurationFile string, backend StorageBackend) *ClientParams {
+	if backend == nil {
+		backend = NewLBCTLBackend(configurationFile)
+	}
+	return &ClientParams{configurationFile: configurationFile, backend: backend}
 }
 
 // ConfigurationFile changes the configuration file on the client
@@ -19,6 +28,12 @@ func (c *ClientParams) ConfigurationFile() string {
 	return c.configurationFile
 }
 
+// Backend returns the StorageBackend the client should route its reads and
+// writes through.
+func (c *ClientParams) Backend() StorageBackend {
+	return c.backend
+}
+
 // Client interface is the interface used for managing HAProxy configuration
 // file.
 type Client interface {
@@ -59,4 +74,13 @@ type Client interface {
 	DeleteListener(name string, frontend string, transactionID string, version int64) error
 	CreateListener(frontend string, data *models.Listener, transactionID string, version int64) error
 	EditListener(name string, frontend string, data *models.Listener, transactionID string, version int64) error
-}
\ No newline at end of file
+	//config template methods
+	CreateConfigTemplate(name string, tmpl ConfigTemplate) error
+	ApplyConfig(templateName string, values map[string]interface{}) (instanceID string, err error)
+	RollbackConfig(instanceID string) error
+	//watch methods
+	WatchRules(ctx context.Context, filter WatchFilter) (<-chan RuleEvent, error)
+	//snapshot methods
+	ExportSnapshot(w io.Writer, opts SnapshotOptions) error
+	ImportSnapshot(r io.Reader, transactionID string) error
+}
@@ -0,0 +1,151 @@
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/concurrency"
+)
+
+// connect lazily dials the etcd cluster on first use and then hands out the
+// same long-lived *clientv3.Client to every subsequent call, so a single
+// rule mutation (a Get followed by a CAS Write) doesn't pay for two fresh
+// TCP handshakes and TLS negotiations.
+func (b *EtcdV3Backend) connect() (*clientv3.Client, error) {
+	b.connectOnce.Do(func() {
+		b.client, b.connectErr = clientv3.New(clientv3.Config{
+			Endpoints:   b.endpoints,
+			DialTimeout: 5 * time.Second,
+			TLS:         b.tlsConfig,
+		})
+	})
+	return b.client, b.connectErr
+}
+
+func (b *EtcdV3Backend) key(parts ...string) string {
+	return path.Join(append([]string{b.prefix}, parts...)...)
+}
+
+// Read fetches the payload stored for ruleKind under the given parent along
+// with the etcd revision it was read at. transactionID is accepted to
+// satisfy StorageBackend but otherwise unused: etcd has no notion of a
+// lbctl-style open transaction, so a read always observes the last committed
+// revision. Callers that need read-your-own-write semantics against etcd use
+// the CAS mirror (see ruleBackendKey) instead of Read.
+func (b *EtcdV3Backend) Read(parentType, parentName, ruleKind, transactionID string) ([]byte, int64, error) {
+	cli, err := b.connect()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := cli.Get(context.Background(), b.key(parentType, parentName, ruleKind))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, nil
+	}
+	return resp.Kvs[0].Value, resp.Kvs[0].ModRevision, nil
+}
+
+// Get returns the raw value stored under key together with its mod
+// revision, or a nil value and revision 0 if key does not exist — 0 is also
+// what Write's CAS compares a missing key's ModRevision against, so
+// Get-then-Write round-trips into a create for a key that isn't there yet.
+func (b *EtcdV3Backend) Get(key string) ([]byte, int64, error) {
+	cli, err := b.connect()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := cli.Get(context.Background(), b.key(key))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, nil
+	}
+	return resp.Kvs[0].Value, resp.Kvs[0].ModRevision, nil
+}
+
+// Write performs a single etcd transaction that only applies value when the
+// key's current mod revision still equals expectedRev, giving callers
+// compare-and-swap semantics so two controllers editing the same rule can't
+// silently clobber each other. expectedRev of 0 means "key must not exist
+// yet".
+func (b *EtcdV3Backend) Write(ctx context.Context, key string, value []byte, expectedRev int64) error {
+	cli, err := b.connect()
+	if err != nil {
+		return err
+	}
+
+	fullKey := b.key(key)
+	txn := cli.Txn(ctx).If(
+		clientv3.Compare(clientv3.ModRevision(fullKey), "=", expectedRev),
+	).Then(
+		clientv3.OpPut(fullKey, string(value)),
+	)
+	resp, err := txn.Commit()
+	if err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrBackendVersionMismatch
+	}
+	return nil
+}
+
+// Watch streams every change to keys under prefix, translating etcd watch
+// events into Events until ctx is cancelled.
+func (b *EtcdV3Backend) Watch(ctx context.Context, prefix string) <-chan Event {
+	out := make(chan Event)
+	cli, err := b.connect()
+	if err != nil {
+		close(out)
+		return out
+	}
+
+	go func() {
+		defer close(out)
+		watchChan := cli.Watch(ctx, b.key(prefix), clientv3.WithPrefix())
+		for resp := range watchChan {
+			for _, ev := range resp.Events {
+				out <- Event{
+					Key:     string(ev.Kv.Key),
+					Value:   ev.Kv.Value,
+					Version: ev.Kv.ModRevision,
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Lock acquires a TTL-bound etcd session lock named name so that it is
+// released automatically if the holder crashes without calling unlock.
+func (b *EtcdV3Backend) Lock(ctx context.Context, name string, ttl time.Duration) (func() error, error) {
+	cli, err := b.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := concurrency.NewSession(cli, concurrency.WithTTL(int(ttl.Seconds())))
+	if err != nil {
+		return nil, err
+	}
+
+	mutex := concurrency.NewMutex(session, b.key("locks", name))
+	if err := mutex.Lock(ctx); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("configuration: acquiring etcd lock %s: %w", name, err)
+	}
+
+	unlock := func() error {
+		defer session.Close()
+		return mutex.Unlock(ctx)
+	}
+	return unlock, nil
+}
@@ -0,0 +1,432 @@
+package configuration
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/haproxytech/models"
+)
+
+// SnapshotOptions controls what ExportSnapshot records in the manifest.
+type SnapshotOptions struct {
+	HAProxyVersion string
+	SchemaRevision string
+	Timestamp      int64
+}
+
+// SnapshotManifest describes where a snapshot archive came from. It is
+// stored inside the checksummed document, so reading it means decompressing
+// and decoding the archive.
+type SnapshotManifest struct {
+	HAProxyVersion string `json:"haproxy_version"`
+	ConfigVersion  int64  `json:"config_version"`
+	Timestamp      int64  `json:"timestamp"`
+	SchemaRevision string `json:"schema_revision"`
+}
+
+// snapshotDocument is every object reachable through the Client interface,
+// grouped the same way the CRUD funcs in this chunk take their parents.
+type snapshotDocument struct {
+	Manifest              SnapshotManifest                        `json:"manifest"`
+	Sites                 models.Sites                            `json:"sites"`
+	Frontends             models.Frontends                        `json:"frontends"`
+	Backends              models.Backends                         `json:"backends"`
+	Listeners             map[string]models.Listeners             `json:"listeners"`               // by frontend
+	Servers               map[string]models.Servers               `json:"servers"`                 // by backend
+	BackendSwitchingRules map[string]models.BackendSwitchingRules `json:"backend_switching_rules"` // by frontend
+	TCPRules              map[string]models.TCPRules              `json:"tcp_rules"`               // by "parentType/parentName/ruleType"
+}
+
+// snapshotEnvelope is the archive's body: a checksum over the JSON-encoded
+// document it wraps, so ImportSnapshot can validate integrity before it
+// decodes, let alone applies, anything.
+type snapshotEnvelope struct {
+	Checksum string          `json:"checksum"` // sha256 of Document, hex-encoded
+	Document json.RawMessage `json:"document"`
+}
+
+// ExportSnapshot serializes every object reachable through Client into a
+// single gzip-compressed, SHA-256-checksummed archive, giving GitOps users a
+// reproducible artifact per config version and a disaster-recovery path.
+func (c *Client) ExportSnapshot(w io.Writer, opts SnapshotOptions) error {
+	version, err := c.GetVersion("")
+	if err != nil {
+		return err
+	}
+
+	doc, err := c.gatherSnapshot()
+	if err != nil {
+		return err
+	}
+	doc.Manifest = SnapshotManifest{
+		HAProxyVersion: opts.HAProxyVersion,
+		ConfigVersion:  version,
+		Timestamp:      opts.Timestamp,
+		SchemaRevision: opts.SchemaRevision,
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+
+	envelope, err := json.Marshal(snapshotEnvelope{Checksum: hex.EncodeToString(sum[:]), Document: body})
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(envelope); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ImportSnapshot validates the checksum of the archive read from r, then
+// diffs it against the live configuration and issues the minimal set of
+// create/edit/delete calls needed to match it, all inside transactionID.
+func (c *Client) ImportSnapshot(r io.Reader, transactionID string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("configuration: snapshot is not gzip-compressed: %w", err)
+	}
+	defer gz.Close()
+
+	raw, err := ioutil.ReadAll(gz)
+	if err != nil {
+		return err
+	}
+
+	var envelope snapshotEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("configuration: malformed snapshot envelope: %w", err)
+	}
+
+	sum := sha256.Sum256(envelope.Document)
+	if hex.EncodeToString(sum[:]) != envelope.Checksum {
+		return fmt.Errorf("configuration: snapshot checksum mismatch, refusing to import")
+	}
+
+	var want snapshotDocument
+	if err := json.Unmarshal(envelope.Document, &want); err != nil {
+		return fmt.Errorf("configuration: malformed snapshot document: %w", err)
+	}
+
+	have, err := c.gatherSnapshot()
+	if err != nil {
+		return err
+	}
+
+	return c.applySnapshotDiff(transactionID, have, &want)
+}
+
+func (c *Client) gatherSnapshot() (*snapshotDocument, error) {
+	doc := &snapshotDocument{
+		Listeners:             map[string]models.Listeners{},
+		Servers:               map[string]models.Servers{},
+		BackendSwitchingRules: map[string]models.BackendSwitchingRules{},
+		TCPRules:              map[string]models.TCPRules{},
+	}
+
+	sites, err := c.GetSites()
+	if err != nil {
+		return nil, err
+	}
+	doc.Sites = sites.Data
+
+	frontends, err := c.GetFrontends()
+	if err != nil {
+		return nil, err
+	}
+	doc.Frontends = frontends.Data
+
+	backends, err := c.GetBackends()
+	if err != nil {
+		return nil, err
+	}
+	doc.Backends = backends.Data
+
+	for _, frontend := range doc.Frontends {
+		listeners, err := c.GetListeners(frontend.Name)
+		if err != nil {
+			return nil, err
+		}
+		doc.Listeners[frontend.Name] = listeners.Data
+
+		bckRules, err := c.GetBackendSwitchingRules(frontend.Name, "")
+		if err != nil {
+			return nil, err
+		}
+		doc.BackendSwitchingRules[frontend.Name] = bckRules.Data
+
+		reqRules, err := c.GetTCPContentRules("frontend", frontend.Name, "request", "")
+		if err != nil {
+			return nil, err
+		}
+		doc.TCPRules["frontend/"+frontend.Name+"/request"] = reqRules.Data
+	}
+
+	for _, backend := range doc.Backends {
+		servers, err := c.GetServers(backend.Name)
+		if err != nil {
+			return nil, err
+		}
+		doc.Servers[backend.Name] = servers.Data
+
+		reqRules, err := c.GetTCPContentRules("backend", backend.Name, "request", "")
+		if err != nil {
+			return nil, err
+		}
+		doc.TCPRules["backend/"+backend.Name+"/request"] = reqRules.Data
+
+		rspRules, err := c.GetTCPContentRules("backend", backend.Name, "response", "")
+		if err != nil {
+			return nil, err
+		}
+		doc.TCPRules["backend/"+backend.Name+"/response"] = rspRules.Data
+	}
+
+	return doc, nil
+}
+
+func (c *Client) applySnapshotDiff(transactionID string, have, want *snapshotDocument) error {
+	if err := diffSites(c, transactionID, have.Sites, want.Sites); err != nil {
+		return err
+	}
+	if err := diffBackends(c, transactionID, have.Backends, want.Backends); err != nil {
+		return err
+	}
+	if err := diffFrontends(c, transactionID, have.Frontends, want.Frontends); err != nil {
+		return err
+	}
+	for frontend, wantListeners := range want.Listeners {
+		if err := diffListeners(c, transactionID, frontend, have.Listeners[frontend], wantListeners); err != nil {
+			return err
+		}
+	}
+	for backend, wantServers := range want.Servers {
+		if err := diffServers(c, transactionID, backend, have.Servers[backend], wantServers); err != nil {
+			return err
+		}
+	}
+	for frontend, wantRules := range want.BackendSwitchingRules {
+		if err := diffBackendSwitchingRules(c, transactionID, frontend, have.BackendSwitchingRules[frontend], wantRules); err != nil {
+			return err
+		}
+	}
+	for key, wantRules := range want.TCPRules {
+		parentType, parentName, ruleType, err := splitSnapshotTCPRuleKey(key)
+		if err != nil {
+			return err
+		}
+		if err := diffTCPRules(c, transactionID, parentType, parentName, ruleType, have.TCPRules[key], wantRules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diffSites(c *Client, transactionID string, have, want models.Sites) error {
+	haveByName := make(map[string]*models.Site, len(have))
+	for _, site := range have {
+		haveByName[site.Name] = site
+	}
+	for _, site := range want {
+		if existing, ok := haveByName[site.Name]; ok {
+			delete(haveByName, site.Name)
+			if !reflect.DeepEqual(existing, site) {
+				if err := c.EditSite(site.Name, site, transactionID, 0); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := c.CreateSite(site, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	for name := range haveByName {
+		if err := c.DeleteSite(name, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diffFrontends(c *Client, transactionID string, have, want models.Frontends) error {
+	haveByName := make(map[string]*models.Frontend, len(have))
+	for _, frontend := range have {
+		haveByName[frontend.Name] = frontend
+	}
+	for _, frontend := range want {
+		if existing, ok := haveByName[frontend.Name]; ok {
+			delete(haveByName, frontend.Name)
+			if !reflect.DeepEqual(existing, frontend) {
+				if err := c.EditFrontend(frontend.Name, frontend, transactionID, 0); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := c.CreateFrontend(frontend, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	for name := range haveByName {
+		if err := c.DeleteFrontend(name, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diffBackends(c *Client, transactionID string, have, want models.Backends) error {
+	haveByName := make(map[string]*models.Backend, len(have))
+	for _, backend := range have {
+		haveByName[backend.Name] = backend
+	}
+	for _, backend := range want {
+		if existing, ok := haveByName[backend.Name]; ok {
+			delete(haveByName, backend.Name)
+			if !reflect.DeepEqual(existing, backend) {
+				if err := c.EditBackend(backend.Name, backend, transactionID, 0); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := c.CreateBackend(backend, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	for name := range haveByName {
+		if err := c.DeleteBackend(name, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diffListeners(c *Client, transactionID, frontend string, have, want models.Listeners) error {
+	haveByName := make(map[string]*models.Listener, len(have))
+	for _, listener := range have {
+		haveByName[listener.Name] = listener
+	}
+	for _, listener := range want {
+		if existing, ok := haveByName[listener.Name]; ok {
+			delete(haveByName, listener.Name)
+			if !reflect.DeepEqual(existing, listener) {
+				if err := c.EditListener(listener.Name, frontend, listener, transactionID, 0); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := c.CreateListener(frontend, listener, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	for name := range haveByName {
+		if err := c.DeleteListener(name, frontend, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diffServers(c *Client, transactionID, backend string, have, want models.Servers) error {
+	haveByName := make(map[string]*models.Server, len(have))
+	for _, server := range have {
+		haveByName[server.Name] = server
+	}
+	for _, server := range want {
+		if existing, ok := haveByName[server.Name]; ok {
+			delete(haveByName, server.Name)
+			if !reflect.DeepEqual(existing, server) {
+				if err := c.EditServer(server.Name, backend, server, transactionID, 0); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := c.CreateServer(backend, server, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	for name := range haveByName {
+		if err := c.DeleteServer(name, backend, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diffBackendSwitchingRules(c *Client, transactionID, frontend string, have, want models.BackendSwitchingRules) error {
+	haveByID := make(map[int64]*models.BackendSwitchingRule, len(have))
+	for _, rule := range have {
+		haveByID[rule.ID] = rule
+	}
+	for _, rule := range want {
+		if existing, ok := haveByID[rule.ID]; ok {
+			delete(haveByID, rule.ID)
+			if !reflect.DeepEqual(existing, rule) {
+				if err := c.EditBackendSwitchingRule(rule.ID, frontend, rule, transactionID, 0); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := c.CreateBackendSwitchingRule(frontend, rule, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	for id := range haveByID {
+		if err := c.DeleteBackendSwitchingRule(id, frontend, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func diffTCPRules(c *Client, transactionID, parentType, parentName, ruleType string, have, want models.TCPRules) error {
+	haveByID := make(map[int64]*models.TCPRule, len(have))
+	for _, rule := range have {
+		haveByID[rule.ID] = rule
+	}
+	for _, rule := range want {
+		if existing, ok := haveByID[rule.ID]; ok {
+			delete(haveByID, rule.ID)
+			if !reflect.DeepEqual(existing, rule) {
+				if err := c.EditTCPContentRule(rule.ID, parentType, parentName, ruleType, rule, transactionID, 0); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := c.CreateTCPContentRule(parentType, parentName, ruleType, rule, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	for id := range haveByID {
+		if err := c.DeleteTCPContentRule(id, parentType, parentName, ruleType, transactionID, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitSnapshotTCPRuleKey(key string) (parentType, parentName, ruleType string, err error) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("configuration: invalid tcp rule key %q in snapshot", key)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
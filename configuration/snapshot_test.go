@@ -0,0 +1,19 @@
+package configuration
+
+import "testing"
+
+func TestSplitSnapshotTCPRuleKey(t *testing.T) {
+	parentType, parentName, ruleType, err := splitSnapshotTCPRuleKey("backend/be1/response")
+	if err != nil {
+		t.Fatalf("splitSnapshotTCPRuleKey: %v", err)
+	}
+	if parentType != "backend" || parentName != "be1" || ruleType != "response" {
+		t.Errorf("splitSnapshotTCPRuleKey = %q, %q, %q; want backend, be1, response", parentType, parentName, ruleType)
+	}
+}
+
+func TestSplitSnapshotTCPRuleKeyRejectsMalformedKey(t *testing.T) {
+	if _, _, _, err := splitSnapshotTCPRuleKey("backend/be1"); err == nil {
+		t.Error("expected an error for a snapshot TCP rule key missing its rule type segment")
+	}
+}
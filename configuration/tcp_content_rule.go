@@ -1,6 +1,7 @@
 package configuration
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -44,13 +45,25 @@ func (c *Client) GetTCPContentRules(parentType, parentName, ruleType, transactio
 		return nil, NewConfError(ErrValidationError, fmt.Sprintf("Rule type %v not recognized", ruleType))
 	}
 
-	tcpRulesStr, err := c.executeLBCTL("l7-"+lbctlType+"-"+lbctlRType+"-dump", "", parentName)
-	if err != nil {
-		return nil, err
+	var tcpRules models.TCPRules
+	if _, shared := c.usesSharedBackend(); shared {
+		raw, _, err := c.Backend.Get(ruleBackendKey(parentType, parentName, "tcp_content_rule_"+ruleType))
+		if err != nil {
+			return nil, err
+		}
+		if raw != nil {
+			if err := json.Unmarshal(raw, &tcpRules); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		tcpRulesRaw, _, err := c.Backend.Read(parentType, parentName, "l7-"+lbctlType+"-"+lbctlRType, transactionID)
+		if err != nil {
+			return nil, err
+		}
+		tcpRules = c.parseTCPContentRules(string(tcpRulesRaw))
 	}
 
-	tcpRules := c.parseTCPContentRules(tcpRulesStr)
-
 	v, err := c.GetVersion(transactionID)
 	if err != nil {
 		return nil, err
@@ -151,6 +164,18 @@ func (c *Client) DeleteTCPContentRule(id int64, parentType, parentName, ruleType
 	if err != nil {
 		return err
 	}
+	err = c.mirrorTCPContentRules(parentType, parentName, ruleType, func(rules models.TCPRules) models.TCPRules {
+		out := rules[:0]
+		for _, rule := range rules {
+			if rule.ID != id {
+				out = append(out, rule)
+			}
+		}
+		return out
+	})
+	if err != nil {
+		return err
+	}
 	if c.Cache.Enabled() {
 		if ruleType == "request" {
 			c.Cache.TcpContentRequestRules.InvalidateParent(transactionID, parentName, parentType)
@@ -158,6 +183,7 @@ func (c *Client) DeleteTCPContentRule(id int64, parentType, parentName, ruleType
 			c.Cache.TcpContentResponseRules.InvalidateBackend(transactionID, parentName)
 		}
 	}
+	c.publishRuleEvent(RuleEvent{ParentType: parentType, ParentName: parentName, RuleKind: "tcp_content_rule_" + ruleType, ID: strconv.FormatInt(id, 10), Op: RuleOpDelete})
 	return nil
 }
 
@@ -193,6 +219,12 @@ func (c *Client) CreateTCPContentRule(parentType, parentName, ruleType string, d
 	if err != nil {
 		return err
 	}
+	err = c.mirrorTCPContentRules(parentType, parentName, ruleType, func(rules models.TCPRules) models.TCPRules {
+		return append(rules, data)
+	})
+	if err != nil {
+		return err
+	}
 	if c.Cache.Enabled() {
 		if ruleType == "request" {
 			c.Cache.TcpContentRequestRules.InvalidateParent(transactionID, parentName, parentType)
@@ -200,6 +232,7 @@ func (c *Client) CreateTCPContentRule(parentType, parentName, ruleType string, d
 			c.Cache.TcpContentResponseRules.InvalidateBackend(transactionID, parentName)
 		}
 	}
+	c.publishRuleEvent(RuleEvent{ParentType: parentType, ParentName: parentName, RuleKind: "tcp_content_rule_" + ruleType, ID: strconv.FormatInt(data.ID, 10), Op: RuleOpCreate, After: data})
 	return nil
 }
 
@@ -241,6 +274,18 @@ func (c *Client) EditTCPContentRule(id int64, parentType, parentName, ruleType s
 	if err != nil {
 		return err
 	}
+	err = c.mirrorTCPContentRules(parentType, parentName, ruleType, func(rules models.TCPRules) models.TCPRules {
+		for i, rule := range rules {
+			if rule.ID == data.ID {
+				rules[i] = data
+				return rules
+			}
+		}
+		return append(rules, data)
+	})
+	if err != nil {
+		return err
+	}
 	if c.Cache.Enabled() {
 		if ruleType == "request" {
 			c.Cache.TcpContentRequestRules.InvalidateParent(transactionID, parentName, parentType)
@@ -248,6 +293,7 @@ func (c *Client) EditTCPContentRule(id int64, parentType, parentName, ruleType s
 			c.Cache.TcpContentResponseRules.InvalidateBackend(transactionID, parentName)
 		}
 	}
+	c.publishRuleEvent(RuleEvent{ParentType: parentType, ParentName: parentName, RuleKind: "tcp_content_rule_" + ruleType, ID: strconv.FormatInt(data.ID, 10), Op: RuleOpEdit, Before: ondiskBr.Data, After: data})
 	return nil
 }
 
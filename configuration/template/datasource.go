@@ -0,0 +1,41 @@
+package template
+
+import "context"
+
+// DataSource supplies the values a Template is rendered with and notifies
+// the Runner whenever those values change so it knows to re-render. Consul,
+// DNS SRV polling, a static JSON blob and a file watcher are all
+// DataSources; the Runner does not care which one it is driven by.
+type DataSource interface {
+	// Values returns the current snapshot to render the template with.
+	Values(ctx context.Context) (map[string]interface{}, error)
+	// Changes is sent on every time the underlying data changes. It is
+	// closed once the DataSource is done producing updates.
+	Changes() <-chan struct{}
+}
+
+// StaticDataSource is a DataSource whose values never change after
+// construction. It is mainly useful for tests and for templates that only
+// depend on values supplied up front.
+type StaticDataSource struct {
+	values  map[string]interface{}
+	changes chan struct{}
+}
+
+// NewStaticDataSource returns a DataSource that always renders with values
+// and fires once immediately so the Runner performs an initial render.
+func NewStaticDataSource(values map[string]interface{}) *StaticDataSource {
+	changes := make(chan struct{}, 1)
+	changes <- struct{}{}
+	return &StaticDataSource{values: values, changes: changes}
+}
+
+// Values returns the fixed snapshot passed to NewStaticDataSource.
+func (s *StaticDataSource) Values(ctx context.Context) (map[string]interface{}, error) {
+	return s.values, nil
+}
+
+// Changes returns the channel that fired once at construction time.
+func (s *StaticDataSource) Changes() <-chan struct{} {
+	return s.changes
+}
@@ -0,0 +1,339 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haproxytech/client-native/configuration"
+	"github.com/haproxytech/models"
+)
+
+// Runner continuously renders a Template against a DataSource and
+// reconciles the result into a configuration.Client, the way
+// consul-template's runner keeps a rendered file in sync with Consul.
+type Runner struct {
+	client *configuration.Client
+	tmpl   Template
+	source DataSource
+	splay  time.Duration
+
+	mu   sync.Mutex
+	last *RenderedConfig
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewRunner creates a Runner that renders tmpl with values from source and
+// applies the result to client. splay adds a random delay of up to its
+// value before each reconcile so many runners started at once don't all
+// reload HAProxy in the same instant; pass 0 to reconcile immediately.
+func NewRunner(client *configuration.Client, tmpl Template, source DataSource, splay time.Duration) *Runner {
+	return &Runner{
+		client: client,
+		tmpl:   tmpl,
+		source: source,
+		splay:  splay,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Run blocks, re-rendering and reconciling every time source reports a
+// change, until ctx is cancelled or Stop is called. Run closes the channel
+// returned by Done before it returns.
+func (r *Runner) Run(ctx context.Context) {
+	defer close(r.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.stop:
+			return
+		case _, ok := <-r.source.Changes():
+			if !ok {
+				return
+			}
+			if r.splay > 0 {
+				select {
+				case <-time.After(time.Duration(rand.Int63n(int64(r.splay)))):
+				case <-ctx.Done():
+					return
+				case <-r.stop:
+					return
+				}
+			}
+			if err := r.reconcileOnce(ctx); err != nil {
+				// A real deployment would surface this through the
+				// client's own error reporting; the next change (or the
+				// data source's own retry) drives the next attempt.
+				continue
+			}
+		}
+	}
+}
+
+// Stop signals Run to return. It is safe to call Stop more than once or
+// before Run has started.
+func (r *Runner) Stop() {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+}
+
+// Done returns a channel that is closed once Run has returned.
+func (r *Runner) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *Runner) reconcileOnce(ctx context.Context) error {
+	values, err := r.source.Values(ctx)
+	if err != nil {
+		return fmt.Errorf("template: reading data source: %w", err)
+	}
+
+	rendered, err := r.tmpl.Render(values)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if configsEqual(r.last, rendered) {
+		return nil
+	}
+
+	if err := r.apply(rendered); err != nil {
+		return err
+	}
+	r.last = rendered
+	return nil
+}
+
+// apply reconciles rendered against the live configuration inside a single
+// transaction so HAProxy only ever sees a consistent intermediate state.
+func (r *Runner) apply(rendered *RenderedConfig) error {
+	version, err := r.client.GetVersion("")
+	if err != nil {
+		return err
+	}
+	transaction, err := r.client.StartTransaction(version)
+	if err != nil {
+		return err
+	}
+
+	if err := r.applyBackendSwitchingRules(rendered, transaction.ID); err != nil {
+		return err
+	}
+	if err := r.applyTCPRules(rendered, transaction.ID); err != nil {
+		return err
+	}
+	if err := r.applyServers(rendered, transaction.ID); err != nil {
+		return err
+	}
+
+	return r.client.CommitTransaction(transaction.ID)
+}
+
+func (r *Runner) applyBackendSwitchingRules(rendered *RenderedConfig, transactionID string) error {
+	for frontend, wanted := range rendered.BackendSwitchingRules {
+		existing, err := r.client.GetBackendSwitchingRules(frontend, transactionID)
+		if err != nil {
+			return err
+		}
+		byID := make(map[int64]*models.BackendSwitchingRule, len(wanted))
+		for _, rule := range wanted {
+			byID[rule.ID] = rule
+		}
+		for _, rule := range existing.Data {
+			if _, ok := byID[rule.ID]; !ok {
+				if err := r.client.DeleteBackendSwitchingRule(rule.ID, frontend, transactionID, 0); err != nil {
+					return err
+				}
+			}
+		}
+		for _, rule := range existing.Data {
+			if want, ok := byID[rule.ID]; ok {
+				if err := r.client.EditBackendSwitchingRule(rule.ID, frontend, want, transactionID, 0); err != nil {
+					return err
+				}
+				delete(byID, rule.ID)
+			}
+		}
+		for _, rule := range byID {
+			if err := r.client.CreateBackendSwitchingRule(frontend, rule, transactionID, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Runner) applyTCPRules(rendered *RenderedConfig, transactionID string) error {
+	for key, wanted := range rendered.TCPRules {
+		parentType, parentName, ruleType, err := splitTCPRuleKey(key)
+		if err != nil {
+			return err
+		}
+		existing, err := r.client.GetTCPContentRules(parentType, parentName, ruleType, transactionID)
+		if err != nil {
+			return err
+		}
+		byID := make(map[int64]*models.TCPRule, len(wanted))
+		for _, rule := range wanted {
+			byID[rule.ID] = rule
+		}
+		for _, rule := range existing.Data {
+			if _, ok := byID[rule.ID]; !ok {
+				if err := r.client.DeleteTCPContentRule(rule.ID, parentType, parentName, ruleType, transactionID, 0); err != nil {
+					return err
+				}
+			}
+		}
+		for _, rule := range existing.Data {
+			if want, ok := byID[rule.ID]; ok {
+				if err := r.client.EditTCPContentRule(rule.ID, parentType, parentName, ruleType, want, transactionID, 0); err != nil {
+					return err
+				}
+				delete(byID, rule.ID)
+			}
+		}
+		for _, rule := range byID {
+			if err := r.client.CreateTCPContentRule(parentType, parentName, ruleType, rule, transactionID, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Runner) applyServers(rendered *RenderedConfig, transactionID string) error {
+	for backend, wanted := range rendered.Servers {
+		existing, err := r.client.GetServers(backend)
+		if err != nil {
+			return err
+		}
+		byName := make(map[string]*models.Server, len(wanted))
+		for _, server := range wanted {
+			byName[server.Name] = server
+		}
+		for _, server := range existing.Data {
+			if _, ok := byName[server.Name]; !ok {
+				if err := r.client.DeleteServer(server.Name, backend, transactionID, 0); err != nil {
+					return err
+				}
+			}
+		}
+		for _, server := range existing.Data {
+			if want, ok := byName[server.Name]; ok {
+				if err := r.client.EditServer(server.Name, backend, want, transactionID, 0); err != nil {
+					return err
+				}
+				delete(byName, server.Name)
+			}
+		}
+		for _, server := range byName {
+			if err := r.client.CreateServer(backend, server, transactionID, 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func splitTCPRuleKey(key string) (parentType, parentName, ruleType string, err error) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("template: invalid tcp rule key %q, want parentType/parentName/ruleType", key)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// configsEqual reports whether two renders produce the same rule set by
+// stable key, so the Runner only commits a transaction when something
+// actually changed and doesn't reload HAProxy on every no-op render.
+func configsEqual(a, b *RenderedConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return backendSwitchingRulesEqual(a.BackendSwitchingRules, b.BackendSwitchingRules) &&
+		tcpRulesEqual(a.TCPRules, b.TCPRules) &&
+		serversEqual(a.Servers, b.Servers)
+}
+
+func backendSwitchingRulesEqual(a, b map[string]models.BackendSwitchingRules) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for frontend, aRules := range a {
+		bRules, ok := b[frontend]
+		if !ok || len(aRules) != len(bRules) {
+			return false
+		}
+		aByID := make(map[int64]*models.BackendSwitchingRule, len(aRules))
+		for _, rule := range aRules {
+			aByID[rule.ID] = rule
+		}
+		for _, rule := range bRules {
+			want, ok := aByID[rule.ID]
+			if !ok || !reflect.DeepEqual(want, rule) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func tcpRulesEqual(a, b map[string]models.TCPRules) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, aRules := range a {
+		bRules, ok := b[key]
+		if !ok || len(aRules) != len(bRules) {
+			return false
+		}
+		aByID := make(map[int64]*models.TCPRule, len(aRules))
+		for _, rule := range aRules {
+			aByID[rule.ID] = rule
+		}
+		for _, rule := range bRules {
+			want, ok := aByID[rule.ID]
+			if !ok || !reflect.DeepEqual(want, rule) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func serversEqual(a, b map[string]models.Servers) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for backend, aServers := range a {
+		bServers, ok := b[backend]
+		if !ok || len(aServers) != len(bServers) {
+			return false
+		}
+		aByName := make(map[string]*models.Server, len(aServers))
+		for _, server := range aServers {
+			aByName[server.Name] = server
+		}
+		for _, server := range bServers {
+			want, ok := aByName[server.Name]
+			if !ok || !reflect.DeepEqual(want, server) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/haproxytech/models"
+)
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func TestConfigsEqualIgnoresPointerIdentity(t *testing.T) {
+	// Two distinct *models.Server values with equal content but a Port field
+	// that points at different int64s: a %+v-based comparison would print
+	// that field's address and call these unequal even though they aren't.
+	a := &RenderedConfig{
+		Servers: map[string]models.Servers{
+			"be1": {{Name: "srv1", Address: "10.0.0.1", Port: int64Ptr(8080)}},
+		},
+	}
+	b := &RenderedConfig{
+		Servers: map[string]models.Servers{
+			"be1": {{Name: "srv1", Address: "10.0.0.1", Port: int64Ptr(8080)}},
+		},
+	}
+
+	if !configsEqual(a, b) {
+		t.Fatal("configsEqual reported a difference between two renders with identical content")
+	}
+}
+
+func TestConfigsEqualDetectsRealChange(t *testing.T) {
+	a := &RenderedConfig{
+		Servers: map[string]models.Servers{
+			"be1": {{Name: "srv1", Address: "10.0.0.1"}},
+		},
+	}
+	b := &RenderedConfig{
+		Servers: map[string]models.Servers{
+			"be1": {{Name: "srv1", Address: "10.0.0.2"}},
+		},
+	}
+
+	if configsEqual(a, b) {
+		t.Fatal("configsEqual reported no difference despite a changed server address")
+	}
+}
+
+func TestConfigsEqualNilHandling(t *testing.T) {
+	if configsEqual(nil, &RenderedConfig{}) {
+		t.Fatal("configsEqual treated nil and non-nil renders as equal")
+	}
+	if !configsEqual(nil, nil) {
+		t.Fatal("configsEqual treated two nil renders as unequal")
+	}
+}
@@ -0,0 +1,60 @@
+// Package template renders HAProxy rules from service discovery data and
+// keeps a configuration.Client in sync with the result, the way
+// consul-template keeps a file in sync with a rendered text blob.
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"github.com/haproxytech/models"
+)
+
+// RenderedConfig is what a single Template render pass produces. Rules are
+// grouped by the same parent key the configuration.Client CRUD funcs take,
+// so a Runner can diff and apply them without any extra bookkeeping.
+type RenderedConfig struct {
+	// BackendSwitchingRules is keyed by frontend name.
+	BackendSwitchingRules map[string]models.BackendSwitchingRules `json:"backend_switching_rules"`
+	// TCPRules is keyed by "parentType/parentName/ruleType", e.g.
+	// "backend/servers-api/request".
+	TCPRules map[string]models.TCPRules `json:"tcp_rules"`
+	// Servers is keyed by backend name.
+	Servers map[string]models.Servers `json:"servers"`
+}
+
+// Template renders a RenderedConfig from a data source snapshot.
+type Template interface {
+	Render(values map[string]interface{}) (*RenderedConfig, error)
+}
+
+// TextTemplate is a Template backed by a Go text/template whose executed
+// output is the JSON encoding of a RenderedConfig.
+type TextTemplate struct {
+	tmpl *template.Template
+}
+
+// NewTextTemplate parses body as a Go text/template named name.
+func NewTextTemplate(name, body string) (*TextTemplate, error) {
+	tmpl, err := template.New(name).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("template: parsing %s: %w", name, err)
+	}
+	return &TextTemplate{tmpl: tmpl}, nil
+}
+
+// Render executes the template against values and decodes its output as a
+// RenderedConfig.
+func (t *TextTemplate) Render(values map[string]interface{}) (*RenderedConfig, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, values); err != nil {
+		return nil, fmt.Errorf("template: executing: %w", err)
+	}
+	cfg := &RenderedConfig{}
+	if err := json.Unmarshal(buf.Bytes(), cfg); err != nil {
+		return nil, fmt.Errorf("template: rendered output is not a valid config: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,340 @@
+package configuration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// RuleOp identifies the kind of change a RuleEvent carries.
+type RuleOp string
+
+// The operations a RuleEvent can describe.
+const (
+	RuleOpCreate RuleOp = "create"
+	RuleOpEdit   RuleOp = "edit"
+	RuleOpDelete RuleOp = "delete"
+)
+
+// RuleEvent describes a single change to a rule reachable through Client,
+// mirroring what the existing Cache invalidation points already know at the
+// time they fire.
+type RuleEvent struct {
+	ParentType string
+	ParentName string
+	RuleKind   string
+	ID         string
+	Op         RuleOp
+	// Version is a monotonically increasing cursor: a client that stores
+	// the Version of the last event it saw can pass it back as
+	// WatchFilter.Since on reconnect and replay what it missed, the way an
+	// etcd watch resumes from a revision. Only the most recent
+	// ruleWatchHistoryLimit events are kept for replay.
+	Version int64
+	Before  interface{}
+	After   interface{}
+}
+
+// WatchFilter narrows which rule changes WatchRules delivers. Zero-value
+// fields are wildcards; Since replays history newer than that cursor before
+// streaming live events.
+type WatchFilter struct {
+	ParentType string
+	ParentName string
+	RuleKind   string
+	Since      int64
+}
+
+func (f WatchFilter) matches(evt RuleEvent) bool {
+	if evt.Version <= f.Since {
+		return false
+	}
+	if f.ParentType != "" && f.ParentType != evt.ParentType {
+		return false
+	}
+	if f.ParentName != "" && f.ParentName != evt.ParentName {
+		return false
+	}
+	if f.RuleKind != "" && f.RuleKind != evt.RuleKind {
+		return false
+	}
+	return true
+}
+
+// ruleWatchHub fans RuleEvents out to every active WatchRules subscriber and
+// keeps a bounded replay buffer so a reconnecting subscriber can resume from
+// its last observed Version instead of missing whatever happened meanwhile.
+type ruleWatchHub struct {
+	seq int64
+
+	mu          sync.Mutex
+	subscribers map[chan RuleEvent]WatchFilter
+	history     []RuleEvent
+}
+
+const ruleWatchHistoryLimit = 256
+
+func newRuleWatchHub() *ruleWatchHub {
+	return &ruleWatchHub{subscribers: make(map[chan RuleEvent]WatchFilter)}
+}
+
+func (h *ruleWatchHub) nextVersion() int64 {
+	return atomic.AddInt64(&h.seq, 1)
+}
+
+func (h *ruleWatchHub) publish(evt RuleEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.history = append(h.history, evt)
+	if len(h.history) > ruleWatchHistoryLimit {
+		h.history = h.history[len(h.history)-ruleWatchHistoryLimit:]
+	}
+
+	for ch, filter := range h.subscribers {
+		if !filter.matches(evt) {
+			continue
+		}
+		select {
+		case ch <- evt:
+		default:
+			// A slow subscriber must not block the writer that triggered
+			// this event; it will see the gap the next time it resumes
+			// with Since set to the last Version it actually received.
+		}
+	}
+}
+
+// snapshotHistory returns a copy of the hub's replay buffer, safe to hand to
+// a caller that will persist it without racing further publish calls.
+func (h *ruleWatchHub) snapshotHistory() []RuleEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]RuleEvent, len(h.history))
+	copy(out, h.history)
+	return out
+}
+
+func (h *ruleWatchHub) subscribe(ctx context.Context, filter WatchFilter) <-chan RuleEvent {
+	h.mu.Lock()
+	// The replay below is sent while h.mu is held and before the caller can
+	// read ch, so ch must have room for all of it on top of the live buffer.
+	ch := make(chan RuleEvent, len(h.history)+64)
+	for _, evt := range h.history {
+		if filter.matches(evt) {
+			ch <- evt
+		}
+	}
+	h.subscribers[ch] = filter
+	h.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+		close(ch)
+	}()
+
+	return ch
+}
+
+// watchHubInitMu guards the lazy creation of Client.watchHub. WatchRules and
+// publishRuleEvent both reach c.watchHub from unrelated goroutines (a
+// subscriber's call vs. a concurrent Create/Edit/Delete), so initializing it
+// without this lock is a data race: one goroutine could observe a non-nil
+// but not-yet-initialized hub written by another.
+var watchHubInitMu sync.Mutex
+
+// ruleWatchHistoryKey is where the hub's replay buffer is mirrored in the
+// client's StorageBackend, so a reconnecting watcher can resume with Since
+// across a process restart instead of only within the lifetime of the
+// *Client that happened to be subscribed when the event fired.
+const ruleWatchHistoryKey = "watch/history"
+
+// watchHubFor returns c's ruleWatchHub, creating it (seeded from any
+// persisted history) on first use from either WatchRules or
+// publishRuleEvent, whichever happens first.
+func (c *Client) watchHubFor() *ruleWatchHub {
+	watchHubInitMu.Lock()
+	defer watchHubInitMu.Unlock()
+	if c.watchHub == nil {
+		hub := newRuleWatchHub()
+		if persisted := c.loadPersistedRuleHistory(); len(persisted) > 0 {
+			hub.history = persisted
+			hub.seq = persisted[len(persisted)-1].Version
+		}
+		c.watchHub = hub
+	}
+	return c.watchHub
+}
+
+// loadPersistedRuleHistory and persistRuleHistory only do anything against a
+// shared backend (see usesSharedBackend): LBCTLBackend.Write only recognizes
+// "templates/" and "instances/" as sidecar-blob keys, so a "watch/history"
+// write would fall through to it shelling "lbctl … watch/history <json>" on
+// every single rule mutation. LBCTLBackend.Watch is already a no-op, so
+// there is nothing durable to resume into on that backend anyway.
+
+func (c *Client) loadPersistedRuleHistory() []RuleEvent {
+	if _, shared := c.usesSharedBackend(); !shared {
+		return nil
+	}
+	raw, _, err := c.Backend.Get(ruleWatchHistoryKey)
+	if err != nil || raw == nil {
+		return nil
+	}
+	var history []RuleEvent
+	if err := json.Unmarshal(raw, &history); err != nil {
+		return nil
+	}
+	return history
+}
+
+func (c *Client) persistRuleHistory(history []RuleEvent) {
+	if _, shared := c.usesSharedBackend(); !shared {
+		return
+	}
+	data, err := json.Marshal(history)
+	if err != nil {
+		return
+	}
+	_, rev, err := c.Backend.Get(ruleWatchHistoryKey)
+	if err != nil {
+		return
+	}
+	// Best-effort: a lost CAS race here just means this event is missing
+	// from the durable replay log, not from the live subscribers that
+	// already received it via hub.publish.
+	_ = c.Backend.Write(context.Background(), ruleWatchHistoryKey, data, rev)
+}
+
+// WatchRules streams rule changes matching filter, replaying anything newer
+// than filter.Since from history before switching to live events. When the
+// client's StorageBackend is an EtcdV3Backend, changes made by other
+// processes sharing that backend are mirrored in too, so watchers see
+// cluster-wide rule changes, not just the ones this Client made itself.
+func (c *Client) WatchRules(ctx context.Context, filter WatchFilter) (<-chan RuleEvent, error) {
+	hub := c.watchHubFor()
+	ch := hub.subscribe(ctx, filter)
+
+	if etcdBackend, ok := c.Backend.(*EtcdV3Backend); ok {
+		go c.mirrorEtcdRuleChanges(ctx, etcdBackend, filter)
+	}
+
+	return ch, nil
+}
+
+// mirrorEtcdRuleChanges republishes etcd watch events under filter as
+// RuleEvents with a real Op, ID and parent, decoded from the mirrored rule
+// list ruleBackendKey identifies, so a node that didn't make the change
+// still sees what actually happened. Events this node produced itself (see
+// lastLocalRuleWrite) are dropped, since publishRuleEvent already ran for
+// them at their CRUD call site.
+func (c *Client) mirrorEtcdRuleChanges(ctx context.Context, backend *EtcdV3Backend, filter WatchFilter) {
+	// Only the leading non-empty filter fields narrow the watched prefix: an
+	// empty field in the middle would otherwise collapse under path.Join and
+	// watch an unrelated key. The hub's own filter applies the rest.
+	prefix := "rules"
+	for _, part := range []string{filter.ParentType, filter.ParentName, filter.RuleKind} {
+		if part == "" {
+			break
+		}
+		prefix += "/" + part
+	}
+	previous := map[string][]byte{}
+
+	// When filter pins an exact parent and rule kind, prefix names a single
+	// mirrored key: seed its current value so the first watch event diffs
+	// against what was already there instead of nil, which would otherwise
+	// replay every pre-existing rule as a RuleOpCreate.
+	if filter.ParentType != "" && filter.ParentName != "" && filter.RuleKind != "" {
+		if raw, _, err := backend.Get(prefix); err == nil {
+			previous[prefix] = raw
+		}
+	}
+
+	for ev := range backend.Watch(ctx, prefix) {
+		key := strings.TrimPrefix(ev.Key, backend.key("")+"/")
+
+		if local, ok := lastLocalRuleWrite.Load(key); ok && bytes.Equal(local.([]byte), ev.Value) {
+			previous[key] = ev.Value
+			continue
+		}
+
+		parentType, parentName, ruleKind, err := splitRuleBackendKey(key)
+		if err != nil {
+			continue
+		}
+
+		for _, evt := range diffMirroredRuleEvents(parentType, parentName, ruleKind, previous[key], ev.Value) {
+			c.publishRuleEvent(evt)
+		}
+		previous[key] = ev.Value
+	}
+}
+
+// ruleIdentity is the one field mirrorEtcdRuleChanges needs out of a
+// BackendSwitchingRule or TCPRule to diff two mirrored rule lists.
+type ruleIdentity struct {
+	ID int64 `json:"id"`
+}
+
+// diffMirroredRuleEvents compares the rule list previously mirrored under a
+// ruleBackendKey against its new value and returns one RuleEvent per rule
+// that was added, changed or removed.
+func diffMirroredRuleEvents(parentType, parentName, ruleKind string, before, after []byte) []RuleEvent {
+	beforeByID := ruleEnvelopeByID(before)
+	afterByID := ruleEnvelopeByID(after)
+
+	var events []RuleEvent
+	for id, raw := range afterByID {
+		prev, existed := beforeByID[id]
+		op := RuleOpEdit
+		if !existed {
+			op = RuleOpCreate
+		} else if bytes.Equal(prev, raw) {
+			continue
+		}
+		events = append(events, RuleEvent{ParentType: parentType, ParentName: parentName, RuleKind: ruleKind, ID: strconv.FormatInt(id, 10), Op: op})
+	}
+	for id := range beforeByID {
+		if _, ok := afterByID[id]; !ok {
+			events = append(events, RuleEvent{ParentType: parentType, ParentName: parentName, RuleKind: ruleKind, ID: strconv.FormatInt(id, 10), Op: RuleOpDelete})
+		}
+	}
+	return events
+}
+
+func ruleEnvelopeByID(raw []byte) map[int64]json.RawMessage {
+	if raw == nil {
+		return nil
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil
+	}
+	out := make(map[int64]json.RawMessage, len(list))
+	for _, item := range list {
+		var id ruleIdentity
+		if err := json.Unmarshal(item, &id); err != nil {
+			continue
+		}
+		out[id.ID] = item
+	}
+	return out
+}
+
+// publishRuleEvent stamps evt with the next cursor Version, fans it out to
+// WatchRules subscribers and mirrors the updated history to the
+// StorageBackend so it can be replayed after a restart.
+func (c *Client) publishRuleEvent(evt RuleEvent) {
+	hub := c.watchHubFor()
+	evt.Version = hub.nextVersion()
+	hub.publish(evt)
+	c.persistRuleHistory(hub.snapshotHistory())
+}
@@ -0,0 +1,115 @@
+package configuration
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRuleWatchHubSubscribeReplaysHistory(t *testing.T) {
+	hub := newRuleWatchHub()
+	hub.publish(RuleEvent{ParentType: "frontend", ParentName: "fe1", RuleKind: "backend_switching_rule", ID: "1", Op: RuleOpCreate, Version: hub.nextVersion()})
+	hub.publish(RuleEvent{ParentType: "frontend", ParentName: "fe1", RuleKind: "backend_switching_rule", ID: "2", Op: RuleOpCreate, Version: hub.nextVersion()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := hub.subscribe(ctx, WatchFilter{ParentType: "frontend", ParentName: "fe1", RuleKind: "backend_switching_rule"})
+
+	var got []RuleEvent
+	for i := 0; i < 2; i++ {
+		got = append(got, <-ch)
+	}
+	if len(got) != 2 || got[0].ID != "1" || got[1].ID != "2" {
+		t.Fatalf("subscribe did not replay prior history in order, got %+v", got)
+	}
+}
+
+func TestRuleWatchHubSubscribeHonorsSince(t *testing.T) {
+	hub := newRuleWatchHub()
+	hub.publish(RuleEvent{ID: "1", Op: RuleOpCreate, Version: hub.nextVersion()})
+	cursor := hub.nextVersion()
+	hub.publish(RuleEvent{ID: "2", Op: RuleOpCreate, Version: cursor})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := hub.subscribe(ctx, WatchFilter{Since: cursor})
+
+	select {
+	case evt := <-ch:
+		t.Fatalf("subscribe replayed an event at or before Since: %+v", evt)
+	default:
+	}
+}
+
+func TestRuleWatchHubSnapshotHistoryIsACopy(t *testing.T) {
+	hub := newRuleWatchHub()
+	hub.publish(RuleEvent{ID: "1", Op: RuleOpCreate, Version: hub.nextVersion()})
+
+	snap := hub.snapshotHistory()
+	snap[0].ID = "mutated"
+
+	if hub.history[0].ID != "1" {
+		t.Fatal("snapshotHistory returned a slice that aliases the hub's internal history")
+	}
+}
+
+func TestDiffMirroredRuleEventsCreateEditDelete(t *testing.T) {
+	before := []byte(`[{"id":1},{"id":2},{"id":4,"cond":"if"}]`)
+	after := []byte(`[{"id":1},{"id":3},{"id":4,"cond":"unless"}]`)
+
+	events := diffMirroredRuleEvents("frontend", "fe1", "backend_switching_rule", before, after)
+
+	byID := map[string]RuleOp{}
+	for _, evt := range events {
+		byID[evt.ID] = evt.Op
+	}
+	if byID["2"] != RuleOpDelete {
+		t.Errorf("expected rule 2 to be reported deleted, got %v", byID["2"])
+	}
+	if byID["3"] != RuleOpCreate {
+		t.Errorf("expected rule 3 to be reported created, got %v", byID["3"])
+	}
+	if byID["4"] != RuleOpEdit {
+		t.Errorf("expected rule 4 to be reported edited, got %v", byID["4"])
+	}
+	if _, ok := byID["1"]; ok {
+		t.Errorf("rule 1 is unchanged and should not produce an event, got %v", byID["1"])
+	}
+}
+
+func TestDiffMirroredRuleEventsNilBeforeCreatesEverything(t *testing.T) {
+	after := []byte(`[{"id":1},{"id":2}]`)
+
+	events := diffMirroredRuleEvents("frontend", "fe1", "backend_switching_rule", nil, after)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 create events when there is no prior mirrored value, got %d: %+v", len(events), events)
+	}
+	for _, evt := range events {
+		if evt.Op != RuleOpCreate {
+			t.Errorf("expected RuleOpCreate, got %v", evt.Op)
+		}
+	}
+}
+
+func TestUsesSharedBackend(t *testing.T) {
+	lbctl := &Client{Backend: NewLBCTLBackend("/tmp/haproxy.cfg")}
+	if _, shared := lbctl.usesSharedBackend(); shared {
+		t.Error("LBCTLBackend must not be reported as a shared backend")
+	}
+
+	etcd := &Client{Backend: NewEtcdV3Backend([]string{"127.0.0.1:2379"}, "/client-native", nil)}
+	if _, shared := etcd.usesSharedBackend(); !shared {
+		t.Error("EtcdV3Backend must be reported as a shared backend")
+	}
+}
+
+func TestPersistRuleHistorySkippedOnLBCTLBackend(t *testing.T) {
+	c := &Client{Backend: NewLBCTLBackend("/tmp/haproxy.cfg")}
+	// persistRuleHistory must return before touching c.Backend at all on a
+	// non-shared backend, so this must not attempt to shell out to lbctl
+	// with a bogus "watch/history" action.
+	c.persistRuleHistory([]RuleEvent{{ID: "1"}})
+
+	if got := c.loadPersistedRuleHistory(); got != nil {
+		t.Errorf("expected no persisted history on an LBCTLBackend, got %+v", got)
+	}
+}